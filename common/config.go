@@ -0,0 +1,75 @@
+package common
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// KubernetesConfig contains all the config items for the Kubernetes executor.
+type KubernetesConfig struct {
+	Host            string `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL"`
+	Image           string `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
+	Namespace       string `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
+	NamespaceOverwriteAllowed string `toml:"namespace_overwrite_allowed,omitempty" json:"namespace_overwrite_allowed" long:"namespace-overwrite-allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE' overwrite value"`
+	HelperImage     string `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"(Advanced) Override the default helper image used to clone repos and upload artifacts"`
+	AllowPrivileged bool   `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
+
+	ServiceAccount                 string `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Default service account to be used for making Kubernetes API calls"`
+	ServiceAccountOverwriteAllowed string `toml:"service_account_overwrite_allowed,omitempty" json:"service_account_overwrite_allowed" long:"service-account-overwrite-allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT' overwrite value"`
+
+	NodeSelector                  map[string]string `toml:"node_selector,omitempty" json:"node_selector" long:"node-selector" description:"A toml table/json object of key=value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key=value pairs"`
+	NodeSelectorOverwriteAllowed  string            `toml:"node_selector_overwrite_allowed,omitempty" json:"node_selector_overwrite_allowed" long:"node-selector-overwrite-allowed" env:"KUBERNETES_NODE_SELECTOR_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NODE_SELECTOR_*' values"`
+	PodLabels                     map[string]string `toml:"pod_labels,omitempty" json:"pod_labels" long:"pod-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given labels"`
+	PodLabelsOverwriteAllowed     string            `toml:"pod_labels_overwrite_allowed,omitempty" json:"pod_labels_overwrite_allowed" long:"pod-labels-overwrite-allowed" env:"KUBERNETES_POD_LABELS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_LABELS_*' values"`
+	PodAnnotations                map[string]string `toml:"pod_annotations,omitempty" json:"pod_annotations" long:"pod-annotations" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given annotations"`
+	PodAnnotationsOverwriteAllowed string           `toml:"pod_annotations_overwrite_allowed,omitempty" json:"pod_annotations_overwrite_allowed" long:"pod-annotations-overwrite-allowed" env:"KUBERNETES_POD_ANNOTATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_ANNOTATIONS_*' values"`
+	NodeTolerations                []api.Toleration  `toml:"node_tolerations,omitempty" json:"node_tolerations" description:"Node tolerations to apply to the build pod, allowing it to be scheduled onto tainted nodes"`
+	Affinity                       *api.Affinity     `toml:"affinity,omitempty" json:"affinity" description:"Affinity and anti-affinity rules to apply to the build pod"`
+
+	// PullPolicy is the default ImagePullPolicy applied to every container
+	// the executor creates, unless a per-image pull_policy override is given.
+	PullPolicy string `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Default image pull policy: if-not-present, always or never"`
+
+	CPURequest                     string `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
+	CPURequestOverwriteMaxAllowed  string `toml:"cpu_request_overwrite_max_allowed,omitempty" json:"cpu_request_overwrite_max_allowed" long:"cpu-request-overwrite-max-allowed" env:"KUBERNETES_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_CPU_REQUEST to overwrite the config when its value matches this regex"`
+	CPULimit                       string `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
+	CPULimitOverwriteMaxAllowed    string `toml:"cpu_limit_overwrite_max_allowed,omitempty" json:"cpu_limit_overwrite_max_allowed" long:"cpu-limit-overwrite-max-allowed" env:"KUBERNETES_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_CPU_LIMIT to overwrite the config when its value matches this regex"`
+	MemoryRequest                  string `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested for build containers"`
+	MemoryRequestOverwriteMaxAllowed string `toml:"memory_request_overwrite_max_allowed,omitempty" json:"memory_request_overwrite_max_allowed" long:"memory-request-overwrite-max-allowed" env:"KUBERNETES_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_MEMORY_REQUEST to overwrite the config when its value matches this regex"`
+	MemoryLimit                    string `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
+	MemoryLimitOverwriteMaxAllowed string `toml:"memory_limit_overwrite_max_allowed,omitempty" json:"memory_limit_overwrite_max_allowed" long:"memory-limit-overwrite-max-allowed" env:"KUBERNETES_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_MEMORY_LIMIT to overwrite the config when its value matches this regex"`
+
+	ServiceCPURequest                     string `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
+	ServiceCPURequestOverwriteMaxAllowed  string `toml:"service_cpu_request_overwrite_max_allowed,omitempty" json:"service_cpu_request_overwrite_max_allowed" long:"service-cpu-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_SERVICE_CPU_REQUEST to overwrite the config when its value matches this regex"`
+	ServiceCPULimit                       string `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
+	ServiceCPULimitOverwriteMaxAllowed    string `toml:"service_cpu_limit_overwrite_max_allowed,omitempty" json:"service_cpu_limit_overwrite_max_allowed" long:"service-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_SERVICE_CPU_LIMIT to overwrite the config when its value matches this regex"`
+	ServiceMemoryRequest                  string `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
+	ServiceMemoryRequestOverwriteMaxAllowed string `toml:"service_memory_request_overwrite_max_allowed,omitempty" json:"service_memory_request_overwrite_max_allowed" long:"service-memory-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_SERVICE_MEMORY_REQUEST to overwrite the config when its value matches this regex"`
+	ServiceMemoryLimit                     string `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
+	ServiceMemoryLimitOverwriteMaxAllowed  string `toml:"service_memory_limit_overwrite_max_allowed,omitempty" json:"service_memory_limit_overwrite_max_allowed" long:"service-memory-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_SERVICE_MEMORY_LIMIT to overwrite the config when its value matches this regex"`
+
+	HelperCPURequest                     string `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for the build helper container"`
+	HelperCPURequestOverwriteMaxAllowed  string `toml:"helper_cpu_request_overwrite_max_allowed,omitempty" json:"helper_cpu_request_overwrite_max_allowed" long:"helper-cpu-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_HELPER_CPU_REQUEST to overwrite the config when its value matches this regex"`
+	HelperCPULimit                       string `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to the build helper container"`
+	HelperCPULimitOverwriteMaxAllowed    string `toml:"helper_cpu_limit_overwrite_max_allowed,omitempty" json:"helper_cpu_limit_overwrite_max_allowed" long:"helper-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_HELPER_CPU_LIMIT to overwrite the config when its value matches this regex"`
+	HelperMemoryRequest                  string `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for the build helper container"`
+	HelperMemoryRequestOverwriteMaxAllowed string `toml:"helper_memory_request_overwrite_max_allowed,omitempty" json:"helper_memory_request_overwrite_max_allowed" long:"helper-memory-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_HELPER_MEMORY_REQUEST to overwrite the config when its value matches this regex"`
+	HelperMemoryLimit                    string `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to the build helper container"`
+	HelperMemoryLimitOverwriteMaxAllowed string `toml:"helper_memory_limit_overwrite_max_allowed,omitempty" json:"helper_memory_limit_overwrite_max_allowed" long:"helper-memory-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, allows KUBERNETES_HELPER_MEMORY_LIMIT to overwrite the config when its value matches this regex"`
+
+	// RequestRetryLimit and RetryBackoffMax bound how hard the executor
+	// retries transient Kubernetes API failures (pod creation, exec attach)
+	// before giving up on the build.
+	RequestRetryLimit int           `toml:"request_retry_limit,omitzero" json:"request_retry_limit" long:"request-retry-limit" env:"KUBERNETES_REQUEST_RETRY_LIMIT" description:"Number of times to retry a failing Kubernetes API request before giving up"`
+	RetryBackoffMax   time.Duration `toml:"retry_backoff_max,omitzero" json:"retry_backoff_max" long:"retry-backoff-max" env:"KUBERNETES_RETRY_BACKOFF_MAX" description:"Cap on the exponential backoff delay between retried Kubernetes API requests"`
+
+	// PodSpecTemplate is a path to a YAML file, or an inline YAML document, of
+	// an api.Pod to strategically merge into the pod the executor builds.
+	PodSpecTemplate string `toml:"pod_spec_template,omitempty" json:"pod_spec_template" long:"pod-spec-template" env:"KUBERNETES_POD_SPEC_TEMPLATE" description:"Path to a YAML file, or an inline YAML document, of a Pod to merge into the build pod"`
+
+	// Shell pins the shell used in build/helper containers when the
+	// KUBERNETES_SHELL CI variable isn't set, overriding the executor's
+	// pwsh/bash/sh auto-detection.
+	Shell string `toml:"shell,omitempty" json:"shell" long:"shell" env:"KUBERNETES_SHELL" description:"Name of shell to generate the script (pwsh, bash or sh). Defaults to auto-detection"`
+}
@@ -1,15 +1,23 @@
 package kubernetes
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/context"
 	"k8s.io/kubernetes/pkg/api"
+	kubeerrors "k8s.io/kubernetes/pkg/api/errors"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/restclient"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/retry"
 )
 
 const (
@@ -29,9 +37,28 @@ var (
 	}
 )
 
+// kubernetesOptionsImage accepts either a bare image name ("ruby:2.3") or an
+// object with a "name" and an optional per-image "pull_policy" override, the
+// same way the docker executor's image/services options do.
+type kubernetesOptionsImage struct {
+	Name       string `json:"name"`
+	PullPolicy string `json:"pull_policy"`
+}
+
+func (i *kubernetesOptionsImage) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		i.Name = name
+		return nil
+	}
+
+	type rawImage kubernetesOptionsImage
+	return json.Unmarshal(data, (*rawImage)(i))
+}
+
 type kubernetesOptions struct {
-	Image    string   `json:"image"`
-	Services []string `json:"services"`
+	Image    kubernetesOptionsImage   `json:"image"`
+	Services []kubernetesOptionsImage `json:"services"`
 }
 
 type executor struct {
@@ -40,23 +67,37 @@ type executor struct {
 	kubeClient   *client.Client
 	prepod       *api.Pod
 	pod          *api.Pod
+	pullSecret   *api.Secret
 	options      *kubernetesOptions
 	extraOptions Options
 
-	buildLimits   api.ResourceList
-	serviceLimits api.ResourceList
+	buildResources   resourceTier
+	serviceResources resourceTier
+	helperResources  resourceTier
+
+	scheduling scheduling
+
+	podSpecTemplate *api.Pod
+
+	shell           string
+	scriptConfigMap *api.ConfigMap
 }
 
 func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
+	// Resolve the shell before AbstractExecutor.Prepare runs, so the
+	// BuildShell it derives (and the helper's RunnerCommand) reflect
+	// KUBERNETES_SHELL/config.Kubernetes.Shell instead of the bash default
+	// ExecutorOptions was registered with.
+	if shell := resolveShell(build.Variables, config.Kubernetes.Shell); shell != "" {
+		s.ExecutorOptions.Shell.Shell = shell
+		s.ExecutorOptions.Shell.RunnerCommand = helperRunnerCommand(shell)
+	}
+
 	err := s.AbstractExecutor.Prepare(globalConfig, config, build)
 	if err != nil {
 		return err
 	}
 
-	if s.BuildShell.PassFile {
-		return fmt.Errorf("Kubernetes doesn't support shells that require script file")
-	}
-
 	s.extraOptions = DefaultOptions{s.Build.Variables}
 
 	if !s.Config.Kubernetes.AllowPrivileged && s.extraOptions.Privileged() {
@@ -68,25 +109,25 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	if err = s.validatePullPolicies(); err != nil {
+		return err
+	}
+
 	s.kubeClient, err = getKubeClient(config.Kubernetes)
 	if err != nil {
 		return fmt.Errorf("Error connecting to Kubernetes: %s", err.Error())
 	}
 
-	if s.serviceLimits, err = limits(s.Config.Kubernetes.ServiceCPUs, s.Config.Kubernetes.ServiceMemory); err != nil {
+	if err = s.prepareResources(); err != nil {
 		return err
 	}
 
-	if s.buildLimits, err = limits(s.Config.Kubernetes.CPUs, s.Config.Kubernetes.Memory); err != nil {
-		return err
-	}
-
-	if s.options.Image == "" {
+	if s.options.Image.Name == "" {
 		switch len(s.Config.Kubernetes.Image) {
 		case 0:
 			return fmt.Errorf("no image specified and no default set in config")
 		default:
-			s.options.Image = s.Config.Kubernetes.Image
+			s.options.Image.Name = s.Config.Kubernetes.Image
 		}
 	}
 
@@ -98,7 +139,27 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		s.Config.Kubernetes.Namespace = "default"
 	}
 
-	s.Println("Using Kubernetes executor with image", s.options.Image, "...")
+	if err = s.prepareScheduling(); err != nil {
+		return err
+	}
+
+	if err = s.setupPullSecret(); err != nil {
+		return err
+	}
+
+	if s.podSpecTemplate, err = loadPodSpecTemplate(s.Config.Kubernetes.PodSpecTemplate); err != nil {
+		return err
+	}
+
+	s.shell = s.shellName()
+
+	if s.BuildShell.PassFile {
+		if s.scriptConfigMap, err = s.createScriptConfigMap(""); err != nil {
+			return fmt.Errorf("Error creating script configmap: %s", err.Error())
+		}
+	}
+
+	s.Println("Using Kubernetes executor with image", s.options.Image.Name, "...")
 
 	return nil
 }
@@ -139,37 +200,53 @@ func (s *executor) Cleanup() {
 			s.Errorln(fmt.Sprintf("Error cleaning up pod: %s", err.Error()))
 		}
 	}
+	s.deletePullSecret()
+	s.deleteScriptConfigMap(s.scriptConfigMap)
 	s.AbstractExecutor.Cleanup()
 }
 
-func (s *executor) buildContainer(name, image string, limits api.ResourceList, command ...string) api.Container {
+func (s *executor) buildContainer(name, image string, resources resourceTier, pullPolicyOverride string, command ...string) api.Container {
 	path := strings.Split(s.Build.BuildDir, "/")
 	path = path[:len(path)-1]
 
 	privileged := s.extraOptions.Privileged()
 
+	// Prepare validates config.Kubernetes.PullPolicy and every per-image
+	// override via validatePullPolicies, so this can't fail here.
+	policy, _ := pullPolicy(s.Config.Kubernetes, pullPolicyOverride)
+
+	volumeMounts := []api.VolumeMount{
+		api.VolumeMount{
+			Name:      "repo",
+			MountPath: strings.Join(path, "/"),
+		},
+		api.VolumeMount{
+			Name:      "etc-ssl-certs",
+			MountPath: "/etc/ssl/certs",
+		},
+	}
+
+	if s.BuildShell.PassFile {
+		volumeMounts = append(volumeMounts, api.VolumeMount{
+			Name:      scriptVolumeName,
+			MountPath: scriptMountPath,
+		})
+	}
+
 	return api.Container{
-		Name:    name,
-		Image:   image,
-		Command: command,
-		Env:     buildVariables(s.Build.GetAllVariables().PublicOrInternal()),
+		Name:            name,
+		Image:           image,
+		ImagePullPolicy: policy,
+		Command:         command,
+		Env:             buildVariables(s.Build.GetAllVariables().PublicOrInternal()),
 		Resources: api.ResourceRequirements{
-			Limits: limits,
-		},
-		VolumeMounts: []api.VolumeMount{
-			api.VolumeMount{
-				Name:      "repo",
-				MountPath: strings.Join(path, "/"),
-			},
-			api.VolumeMount{
-				Name:      "etc-ssl-certs",
-				MountPath: "/etc/ssl/certs",
-			},
-			api.VolumeMount{
-				Name:      "usr-share-ca-certificates",
-				MountPath: "/usr/share/ca-certificates",
-			},
+			Requests: resources.requests,
+			Limits:   resources.limits,
 		},
+		VolumeMounts: append(volumeMounts, api.VolumeMount{
+			Name:      "usr-share-ca-certificates",
+			MountPath: "/usr/share/ca-certificates",
+		}),
 		SecurityContext: &api.SecurityContext{
 			Privileged: &privileged,
 		},
@@ -177,50 +254,115 @@ func (s *executor) buildContainer(name, image string, limits api.ResourceList, c
 	}
 }
 
-func (s *executor) setupBuildPod() error {
+// podVolumes returns the volumes every build pod gets, plus the script
+// ConfigMap volume when the selected shell needs its stage script as a file
+// rather than on stdin.
+func (s *executor) podVolumes() []api.Volume {
+	volumes := []api.Volume{
+		api.Volume{
+			Name: "repo",
+			VolumeSource: api.VolumeSource{
+				EmptyDir: &api.EmptyDirVolumeSource{},
+			},
+		},
+		api.Volume{
+			Name: "etc-ssl-certs",
+			VolumeSource: api.VolumeSource{
+				HostPath: &api.HostPathVolumeSource{
+					Path: "/etc/ssl/certs",
+				},
+			},
+		},
+		api.Volume{
+			Name: "usr-share-ca-certificates",
+			VolumeSource: api.VolumeSource{
+				HostPath: &api.HostPathVolumeSource{
+					Path: "/usr/share/ca-certificates",
+				},
+			},
+		},
+	}
+
+	if s.BuildShell.PassFile && s.scriptConfigMap != nil {
+		volumes = append(volumes, scriptVolume(s.scriptConfigMap))
+	}
+
+	return volumes
+}
+
+// buildPodSpec assembles the api.Pod the executor would submit, merging in
+// config.Kubernetes.PodSpecTemplate if one was provided. It performs no API
+// calls, so it can also be used to render a dry-run manifest.
+func (s *executor) buildPodSpec() *api.Pod {
 	services := make([]api.Container, len(s.options.Services))
-	for i, image := range s.options.Services {
-		resolvedImage := s.Build.GetAllVariables().ExpandValue(image)
-		services[i] = s.buildContainer(fmt.Sprintf("svc-%d", i), resolvedImage, s.serviceLimits)
+	for i, service := range s.options.Services {
+		resolvedImage := s.Build.GetAllVariables().ExpandValue(service.Name)
+		services[i] = s.buildContainer(fmt.Sprintf("svc-%d", i), resolvedImage, s.serviceResources, service.PullPolicy)
 	}
 
-	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image)
-	pod, err := s.kubeClient.Pods(s.Config.Kubernetes.Namespace).Create(&api.Pod{
+	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image.Name)
+	pod := &api.Pod{
 		ObjectMeta: api.ObjectMeta{
-			GenerateName: s.Build.ProjectUniqueName(),
-			Namespace:    s.Config.Kubernetes.Namespace,
+			// A deterministic Name rather than GenerateName, so a create
+			// retried after an ambiguous failure (e.g. a response timeout on
+			// an already-successful create) surfaces as AlreadyExists
+			// instead of silently creating a second, orphaned pod for the
+			// same build - see setupBuildPod.
+			Name:         s.Build.ProjectUniqueName(),
+			Namespace:    s.scheduling.namespace,
+			Labels:       s.scheduling.podLabels,
+			Annotations:  s.scheduling.podAnnotations,
 		},
 		Spec: api.PodSpec{
-			Volumes: []api.Volume{
-				api.Volume{
-					Name: "repo",
-					VolumeSource: api.VolumeSource{
-						EmptyDir: &api.EmptyDirVolumeSource{},
-					},
-				},
-				api.Volume{
-					Name: "etc-ssl-certs",
-					VolumeSource: api.VolumeSource{
-						HostPath: &api.HostPathVolumeSource{
-							Path: "/etc/ssl/certs",
-						},
-					},
-				},
-				api.Volume{
-					Name: "usr-share-ca-certificates",
-					VolumeSource: api.VolumeSource{
-						HostPath: &api.HostPathVolumeSource{
-							Path: "/usr/share/ca-certificates",
-						},
-					},
-				},
-			},
-			RestartPolicy: api.RestartPolicyNever,
+			Volumes:            s.podVolumes(),
+			RestartPolicy:      api.RestartPolicyNever,
+			ImagePullSecrets:   s.imagePullSecrets(),
+			NodeSelector:       s.scheduling.nodeSelector,
+			ServiceAccountName: s.scheduling.serviceAccountName,
+			Tolerations:        s.tolerations(),
+			Affinity:           s.affinity(),
 			Containers: append([]api.Container{
-				s.buildContainer("build", buildImage, s.buildLimits, s.BuildShell.DockerCommand...),
-				s.buildContainer("pre", s.Config.Kubernetes.HelperImage, s.serviceLimits, s.BuildShell.DockerCommand...),
+				s.buildContainer("build", buildImage, s.buildResources, s.options.Image.PullPolicy, shellCommand(s.shell)...),
+				s.buildContainer("pre", s.Config.Kubernetes.HelperImage, s.helperResources, "", shellCommand(s.shell)...),
 			}, services...),
 		},
+	}
+
+	return mergePodSpecTemplate(pod, s.podSpecTemplate)
+}
+
+// RenderPodManifest returns the YAML manifest of the pod the executor would
+// submit, without creating it. Nothing in the runner calls it: `gitlab-runner
+// exec` has no --dry-run option.
+func (s *executor) RenderPodManifest() (string, error) {
+	return renderPodManifest(s.buildPodSpec())
+}
+
+func (s *executor) setupBuildPod() error {
+	podSpec := s.buildPodSpec()
+
+	var pod *api.Pod
+	err := s.withRetry("create pod", func() error {
+		created, createErr := s.kubeClient.Pods(s.scheduling.namespace).Create(podSpec)
+		if createErr != nil {
+			if !kubeerrors.IsAlreadyExists(createErr) {
+				return createErr
+			}
+
+			// podSpec.Name is deterministic per build, so AlreadyExists most
+			// likely means an earlier attempt's create succeeded but its
+			// response was lost to the error we're retrying (e.g. a
+			// timeout): adopt that pod instead of failing the build or
+			// leaving it to leak.
+			existing, getErr := s.kubeClient.Pods(s.scheduling.namespace).Get(podSpec.Name)
+			if getErr != nil {
+				return createErr
+			}
+			created = existing
+		}
+
+		pod = created
+		return nil
 	})
 
 	if err != nil {
@@ -232,12 +374,86 @@ func (s *executor) setupBuildPod() error {
 	return nil
 }
 
+// scriptSyncRetryLimit/scriptSyncBackoff bound how long waitForScriptSync
+// polls for the kubelet ConfigMap volume sync before giving up: long enough
+// to ride out the historical up-to-a-minute resync period, not so long a
+// genuinely broken sync hangs the build forever. 25 retries at this backoff
+// sum to about 62s before jitter.
+const scriptSyncRetryLimit = 25
+
+var scriptSyncBackoff = retry.Backoff{
+	Initial: 250 * time.Millisecond,
+	Max:     3 * time.Second,
+	Factor:  1.5,
+}
+
+// waitForScriptSync polls the mounted script file inside containerName until
+// its contents match what updateScriptConfigMap just wrote, so a PassFile
+// exec never runs against content left over from the previous stage.
+func (s *executor) waitForScriptSync(containerName, expected string, config *restclient.Config) error {
+	check := func() error {
+		var out bytes.Buffer
+
+		exec := ExecOptions{
+			PodName:       s.pod.Name,
+			Namespace:     s.pod.Namespace,
+			ContainerName: containerName,
+			Command:       readScriptCommand(s.shell),
+			Out:           &out,
+			Err:           &out,
+			Config:        config,
+			Client:        s.kubeClient,
+			Executor:      &DefaultRemoteExecutor{},
+		}
+
+		if err := exec.Run(); err != nil {
+			return err
+		}
+
+		if out.String() != expected {
+			return fmt.Errorf("script configmap not yet synced to container")
+		}
+
+		return nil
+	}
+
+	return retry.Do(scriptSyncRetryLimit, scriptSyncBackoff, func(error) bool { return true }, func(attempt int, err error, delay time.Duration) {
+		s.Debugln(fmt.Sprintf("Waiting for script configmap to sync to %s (attempt %d): %s", containerName, attempt+1, err.Error()))
+	}, check)
+}
+
+// execOutputTracker notices whether any byte has been written to the build
+// trace, so a failed exec can be told apart from one that already streamed
+// output: retrying the former just re-runs a script that never visibly
+// started, but retrying the latter would re-run a (possibly non-idempotent)
+// script the build log shows as having already executed.
+type execOutputTracker struct {
+	w       io.Writer
+	written int32
+}
+
+func (t *execOutputTracker) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		atomic.StoreInt32(&t.written, 1)
+	}
+	return t.w.Write(p)
+}
+
+func (t *execOutputTracker) wroteAny() bool {
+	return atomic.LoadInt32(&t.written) == 1
+}
+
 func (s *executor) runInContainer(ctx context.Context, name, command string) <-chan error {
 	errc := make(chan error, 1)
 	go func() {
 		defer close(errc)
 
-		status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.BuildTrace)
+		var status api.PodPhase
+		err := s.withRetry("wait for pod running", func() error {
+			var waitErr error
+			status, waitErr = waitForPodRunning(ctx, s.kubeClient, s.pod, s.BuildTrace)
+			return waitErr
+		})
 
 		if err != nil {
 			errc <- err
@@ -256,21 +472,49 @@ func (s *executor) runInContainer(ctx context.Context, name, command string) <-c
 			return
 		}
 
+		execCommand := shellCommand(s.shell)
+		in := strings.NewReader(command)
+
+		if s.BuildShell.PassFile {
+			if err = s.updateScriptConfigMap(command); err != nil {
+				errc <- err
+				return
+			}
+			if err = s.waitForScriptSync(name, command, config); err != nil {
+				errc <- err
+				return
+			}
+			execCommand = scriptFileCommand(s.shell)
+			in = strings.NewReader("")
+		}
+
+		tracker := &execOutputTracker{w: s.BuildTrace}
 		exec := ExecOptions{
 			PodName:       s.pod.Name,
 			Namespace:     s.pod.Namespace,
 			ContainerName: name,
-			Command:       s.BuildShell.DockerCommand,
-			In:            strings.NewReader(command),
-			Out:           s.BuildTrace,
-			Err:           s.BuildTrace,
+			Command:       execCommand,
+			In:            in,
+			Out:           tracker,
+			Err:           tracker,
 			Stdin:         true,
 			Config:        config,
 			Client:        s.kubeClient,
 			Executor:      &DefaultRemoteExecutor{},
 		}
 
-		errc <- exec.Run()
+		// Only retry the exec itself while it has produced no output yet: once
+		// the build trace has shown so much as a byte of it, the script may
+		// already have made non-idempotent changes, so a failure past that
+		// point is returned as-is rather than risking a second run.
+		shouldRetryExec := func(err error) bool {
+			return !tracker.wroteAny() && isRetryableKubernetesError(err)
+		}
+
+		errc <- retry.Do(s.retryLimit(), s.retryBackoff(), shouldRetryExec, func(attempt int, err error, delay time.Duration) {
+			retryAttemptsTotal.WithLabelValues("exec in pod").Inc()
+			s.Warningln(fmt.Sprintf("Retrying exec in pod after error (attempt %d): %s", attempt+1, err.Error()))
+		}, exec.Run)
 	}()
 
 	return errc
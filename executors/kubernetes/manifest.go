@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// renderPodManifest returns the YAML representation of the pod the executor
+// would submit; see executor.RenderPodManifest.
+func renderPodManifest(pod *api.Pod) (string, error) {
+	out, err := yaml.Marshal(pod)
+	if err != nil {
+		return "", fmt.Errorf("rendering pod manifest: %s", err.Error())
+	}
+
+	return string(out), nil
+}
+
+// loadPodSpecTemplate reads config.Kubernetes.PodSpecTemplate, which may be
+// either a path to a YAML file or an inline YAML document, and decodes it
+// into an api.Pod. An empty template returns (nil, nil).
+func loadPodSpecTemplate(template string) (*api.Pod, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, nil
+	}
+
+	raw := []byte(template)
+	if !strings.Contains(template, "\n") {
+		data, err := ioutil.ReadFile(template)
+		if err != nil {
+			return nil, fmt.Errorf("reading pod spec template: %s", err.Error())
+		}
+		raw = data
+	}
+
+	pod := &api.Pod{}
+	if err := yaml.Unmarshal(raw, pod); err != nil {
+		return nil, fmt.Errorf("parsing pod spec template: %s", err.Error())
+	}
+
+	return pod, nil
+}
+
+// mergePodSpecTemplate strategically merges a user-provided template into
+// the pod the executor built, letting admins inject sidecars, volumes and
+// security settings without runner code changes. Runner-owned fields
+// (container identity, image, command, and any volume name the executor
+// already added - "repo", "etc-ssl-certs", "usr-share-ca-certificates",
+// "build-script") are never overwritten.
+func mergePodSpecTemplate(pod *api.Pod, template *api.Pod) *api.Pod {
+	if template == nil {
+		return pod
+	}
+
+	for k, v := range template.ObjectMeta.Labels {
+		if pod.ObjectMeta.Labels == nil {
+			pod.ObjectMeta.Labels = map[string]string{}
+		}
+		if _, exists := pod.ObjectMeta.Labels[k]; !exists {
+			pod.ObjectMeta.Labels[k] = v
+		}
+	}
+
+	for k, v := range template.ObjectMeta.Annotations {
+		if pod.ObjectMeta.Annotations == nil {
+			pod.ObjectMeta.Annotations = map[string]string{}
+		}
+		if _, exists := pod.ObjectMeta.Annotations[k]; !exists {
+			pod.ObjectMeta.Annotations[k] = v
+		}
+	}
+
+	existingVolumes := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		existingVolumes[volume.Name] = true
+	}
+
+	for _, volume := range template.Spec.Volumes {
+		if existingVolumes[volume.Name] {
+			continue
+		}
+		pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
+	}
+
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, template.Spec.Tolerations...)
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, template.Spec.InitContainers...)
+
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = template.Spec.SecurityContext
+	}
+
+	byName := map[string]*api.Container{}
+	for i := range pod.Spec.Containers {
+		byName[pod.Spec.Containers[i].Name] = &pod.Spec.Containers[i]
+	}
+
+	for _, container := range template.Spec.Containers {
+		if existing, ok := byName[container.Name]; ok {
+			existing.Env = append(existing.Env, container.Env...)
+			continue
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+	}
+
+	return pod
+}
@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestLoadPodSpecTemplateEmpty(t *testing.T) {
+	pod, err := loadPodSpecTemplate("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if pod != nil {
+		t.Fatalf("got %+v, want nil", pod)
+	}
+}
+
+func TestLoadPodSpecTemplateInline(t *testing.T) {
+	pod, err := loadPodSpecTemplate("metadata:\n  labels:\n    team: ci\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if pod == nil {
+		t.Fatal("got nil pod")
+	}
+	if pod.ObjectMeta.Labels["team"] != "ci" {
+		t.Fatalf("got labels %v, want team=ci", pod.ObjectMeta.Labels)
+	}
+}
+
+func TestMergePodSpecTemplateNil(t *testing.T) {
+	pod := &api.Pod{Spec: api.PodSpec{Volumes: []api.Volume{{Name: "repo"}}}}
+	merged := mergePodSpecTemplate(pod, nil)
+
+	if merged != pod {
+		t.Fatalf("expected the same pod back when template is nil")
+	}
+}
+
+func TestMergePodSpecTemplateSkipsExistingVolumeNames(t *testing.T) {
+	pod := &api.Pod{
+		Spec: api.PodSpec{
+			Volumes: []api.Volume{
+				{Name: "repo"},
+				{Name: "etc-ssl-certs"},
+				{Name: "usr-share-ca-certificates"},
+				{Name: "build-script"},
+			},
+		},
+	}
+
+	template := &api.Pod{
+		Spec: api.PodSpec{
+			Volumes: []api.Volume{
+				{Name: "repo"},
+				{Name: "etc-ssl-certs"},
+				{Name: "usr-share-ca-certificates"},
+				{Name: "build-script"},
+				{Name: "extra-sidecar-volume"},
+			},
+		},
+	}
+
+	merged := mergePodSpecTemplate(pod, template)
+
+	if len(merged.Spec.Volumes) != 5 {
+		t.Fatalf("got %d volumes, want 5 (4 runner-owned + 1 new): %+v", len(merged.Spec.Volumes), merged.Spec.Volumes)
+	}
+
+	found := false
+	for _, volume := range merged.Spec.Volumes {
+		if volume.Name == "extra-sidecar-volume" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected extra-sidecar-volume to be merged in")
+	}
+}
+
+func TestMergePodSpecTemplateMergesContainerEnv(t *testing.T) {
+	pod := &api.Pod{
+		Spec: api.PodSpec{
+			Containers: []api.Container{
+				{Name: "build", Env: []api.EnvVar{{Name: "EXISTING", Value: "1"}}},
+			},
+		},
+	}
+
+	template := &api.Pod{
+		Spec: api.PodSpec{
+			Containers: []api.Container{
+				{Name: "build", Env: []api.EnvVar{{Name: "EXTRA", Value: "2"}}},
+				{Name: "sidecar", Image: "sidecar:latest"},
+			},
+		},
+	}
+
+	merged := mergePodSpecTemplate(pod, template)
+
+	if len(merged.Spec.Containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(merged.Spec.Containers))
+	}
+
+	build := merged.Spec.Containers[0]
+	if len(build.Env) != 2 {
+		t.Fatalf("got %d env vars on build container, want 2: %+v", len(build.Env), build.Env)
+	}
+}
@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const (
+	pullSecretType = "kubernetes.io/dockerconfigjson"
+	pullSecretKey  = ".dockerconfigjson"
+)
+
+// dockerConfigAuth mirrors the shape of a single entry in a docker config.json
+// "auths" map, as produced by `docker login` and accepted by DOCKER_AUTH_CONFIG.
+type dockerConfigAuth struct {
+	Auth string `json:"auth"`
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+// pullCredentials builds a kubernetes.io/dockerconfigjson Secret out of the
+// DOCKER_AUTH_CONFIG build variable, if one was provided. It returns nil, nil
+// when there's nothing to authenticate with.
+func (s *executor) pullCredentials() (*api.Secret, error) {
+	value := s.Build.GetAllVariables().Get("DOCKER_AUTH_CONFIG")
+	if value == "" {
+		return nil, nil
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal([]byte(value), &cfg); err != nil {
+		return nil, fmt.Errorf("parsing DOCKER_AUTH_CONFIG: %s", err.Error())
+	}
+
+	raw, err := json.Marshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &api.Secret{
+		ObjectMeta: api.ObjectMeta{
+			GenerateName: s.Build.ProjectUniqueName() + "-pull-",
+			Namespace:    s.scheduling.namespace,
+		},
+		Type: pullSecretType,
+		Data: map[string][]byte{
+			pullSecretKey: raw,
+		},
+	}
+
+	return secret, nil
+}
+
+// setupPullSecret creates the pull secret (if any) and remembers it on the
+// executor so it can be attached to the pod and removed again in Cleanup.
+func (s *executor) setupPullSecret() error {
+	secret, err := s.pullCredentials()
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return nil
+	}
+
+	created, err := s.kubeClient.Secrets(s.scheduling.namespace).Create(secret)
+	if err != nil {
+		return fmt.Errorf("creating pull secret: %s", err.Error())
+	}
+
+	s.pullSecret = created
+	return nil
+}
+
+func (s *executor) deletePullSecret() {
+	if s.pullSecret == nil {
+		return
+	}
+
+	err := s.kubeClient.Secrets(s.pullSecret.Namespace).Delete(s.pullSecret.Name)
+	if err != nil {
+		s.Errorln(fmt.Sprintf("Error cleaning up pull secret: %s", err.Error()))
+	}
+}
+
+func (s *executor) imagePullSecrets() []api.LocalObjectReference {
+	if s.pullSecret == nil {
+		return nil
+	}
+
+	return []api.LocalObjectReference{
+		api.LocalObjectReference{Name: s.pullSecret.Name},
+	}
+}
+
+// pullPolicy resolves the effective ImagePullPolicy for a container, given
+// the runner-wide default and an optional per-image override. Both are
+// expected to have already been validated by validatePullPolicy in Prepare.
+func pullPolicy(config *common.KubernetesConfig, override string) (api.PullPolicy, error) {
+	value := override
+	if value == "" {
+		value = config.PullPolicy
+	}
+
+	switch value {
+	case "", "if-not-present":
+		return api.PullIfNotPresent, nil
+	case "always":
+		return api.PullAlways, nil
+	case "never":
+		return api.PullNever, nil
+	default:
+		return "", fmt.Errorf("unsupported kubernetes pull_policy: %q", value)
+	}
+}
+
+// validatePullPolicy rejects anything but the pull_policy values buildContainer
+// actually understands, so a typo (e.g. wrong case, "IfNotPresent") fails the
+// build up front instead of silently falling back to the cluster default.
+func validatePullPolicy(value string) error {
+	switch value {
+	case "", "if-not-present", "always", "never":
+		return nil
+	default:
+		return fmt.Errorf("unsupported kubernetes pull_policy: %q", value)
+	}
+}
+
+// validatePullPolicies checks config.Kubernetes.PullPolicy and every
+// per-image pull_policy override given for this build.
+func (s *executor) validatePullPolicies() error {
+	if err := validatePullPolicy(s.Config.Kubernetes.PullPolicy); err != nil {
+		return err
+	}
+
+	if err := validatePullPolicy(s.options.Image.PullPolicy); err != nil {
+		return err
+	}
+
+	for _, service := range s.options.Services {
+		if err := validatePullPolicy(service.PullPolicy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestValidatePullPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"", false},
+		{"if-not-present", false},
+		{"always", false},
+		{"never", false},
+		{"Always", true},
+		{"IfNotPresent", true},
+		{"bogus", true},
+	}
+
+	for _, test := range tests {
+		err := validatePullPolicy(test.value)
+		if test.wantErr && err == nil {
+			t.Errorf("validatePullPolicy(%q): expected error, got nil", test.value)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("validatePullPolicy(%q): unexpected error: %s", test.value, err.Error())
+		}
+	}
+}
+
+func TestPullPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		override string
+		want     string
+		wantErr  bool
+	}{
+		{"default empty", "", "", "IfNotPresent", false},
+		{"config always", "always", "", "Always", false},
+		{"override wins", "always", "never", "Never", false},
+		{"override empty falls back to config", "never", "", "Never", false},
+		{"invalid override", "always", "bogus", "", true},
+	}
+
+	for _, test := range tests {
+		config := &common.KubernetesConfig{PullPolicy: test.config}
+		got, err := pullPolicy(config, test.override)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if string(got) != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// resourceTier holds the requests/limits pair the executor computes for one
+// of the build, services or helper containers.
+type resourceTier struct {
+	requests api.ResourceList
+	limits   api.ResourceList
+}
+
+// overwriteString returns the value of the given CI variable if it is set
+// and matches overwriteAllowed, or def otherwise. An empty overwriteAllowed
+// rejects every overwrite, matching the executor's existing fail-closed
+// behaviour for other Kubernetes overwrites.
+func overwriteString(variables common.JobVariables, key, overwriteAllowed, def string) (string, error) {
+	value := variables.Get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	if overwriteAllowed == "" {
+		return "", fmt.Errorf("%s overwriting is disabled", key)
+	}
+
+	matched, err := regexp.MatchString(overwriteAllowed, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex for %s overwrite: %s", key, err.Error())
+	}
+	if !matched {
+		return "", fmt.Errorf("%s value %q does not match allowed pattern %q", key, value, overwriteAllowed)
+	}
+
+	return value, nil
+}
+
+// buildResourceTier resolves requests/limits for a single container tier,
+// applying CI variable overwrites that are checked against their respective
+// *OverwriteMaxAllowed regex before being honoured.
+func buildResourceTier(
+	variables common.JobVariables,
+	cpuRequest, cpuRequestOverwrite, cpuRequestVar string,
+	cpuLimit, cpuLimitOverwrite, cpuLimitVar string,
+	memoryRequest, memoryRequestOverwrite, memoryRequestVar string,
+	memoryLimit, memoryLimitOverwrite, memoryLimitVar string,
+) (resourceTier, error) {
+	cpuReq, err := overwriteString(variables, cpuRequestVar, cpuRequestOverwrite, cpuRequest)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	cpuLim, err := overwriteString(variables, cpuLimitVar, cpuLimitOverwrite, cpuLimit)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	memReq, err := overwriteString(variables, memoryRequestVar, memoryRequestOverwrite, memoryRequest)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	memLim, err := overwriteString(variables, memoryLimitVar, memoryLimitOverwrite, memoryLimit)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	requests, err := limits(cpuReq, memReq)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	lims, err := limits(cpuLim, memLim)
+	if err != nil {
+		return resourceTier{}, err
+	}
+
+	return resourceTier{requests: requests, limits: lims}, nil
+}
+
+// prepareResources computes the build, service and helper resource tiers,
+// honouring the per-build CI variable overwrites allowed by config.
+func (s *executor) prepareResources() error {
+	variables := s.Build.GetAllVariables()
+	k := s.Config.Kubernetes
+
+	var err error
+	s.buildResources, err = buildResourceTier(variables,
+		k.CPURequest, k.CPURequestOverwriteMaxAllowed, "KUBERNETES_CPU_REQUEST",
+		k.CPULimit, k.CPULimitOverwriteMaxAllowed, "KUBERNETES_CPU_LIMIT",
+		k.MemoryRequest, k.MemoryRequestOverwriteMaxAllowed, "KUBERNETES_MEMORY_REQUEST",
+		k.MemoryLimit, k.MemoryLimitOverwriteMaxAllowed, "KUBERNETES_MEMORY_LIMIT",
+	)
+	if err != nil {
+		return err
+	}
+
+	s.serviceResources, err = buildResourceTier(variables,
+		k.ServiceCPURequest, k.ServiceCPURequestOverwriteMaxAllowed, "KUBERNETES_SERVICE_CPU_REQUEST",
+		k.ServiceCPULimit, k.ServiceCPULimitOverwriteMaxAllowed, "KUBERNETES_SERVICE_CPU_LIMIT",
+		k.ServiceMemoryRequest, k.ServiceMemoryRequestOverwriteMaxAllowed, "KUBERNETES_SERVICE_MEMORY_REQUEST",
+		k.ServiceMemoryLimit, k.ServiceMemoryLimitOverwriteMaxAllowed, "KUBERNETES_SERVICE_MEMORY_LIMIT",
+	)
+	if err != nil {
+		return err
+	}
+
+	s.helperResources, err = buildResourceTier(variables,
+		k.HelperCPURequest, k.HelperCPURequestOverwriteMaxAllowed, "KUBERNETES_HELPER_CPU_REQUEST",
+		k.HelperCPULimit, k.HelperCPULimitOverwriteMaxAllowed, "KUBERNETES_HELPER_CPU_LIMIT",
+		k.HelperMemoryRequest, k.HelperMemoryRequestOverwriteMaxAllowed, "KUBERNETES_HELPER_MEMORY_REQUEST",
+		k.HelperMemoryLimit, k.HelperMemoryLimitOverwriteMaxAllowed, "KUBERNETES_HELPER_MEMORY_LIMIT",
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestOverwriteString(t *testing.T) {
+	tests := []struct {
+		name             string
+		variables        common.JobVariables
+		key              string
+		overwriteAllowed string
+		def              string
+		want             string
+		wantErr          bool
+	}{
+		{
+			name:      "no variable set falls back to default",
+			variables: common.JobVariables{},
+			key:       "KUBERNETES_CPU_REQUEST",
+			def:       "100m",
+			want:      "100m",
+		},
+		{
+			name:             "overwrite disabled rejects any value",
+			variables:        common.JobVariables{{Key: "KUBERNETES_CPU_REQUEST", Value: "500m"}},
+			key:              "KUBERNETES_CPU_REQUEST",
+			overwriteAllowed: "",
+			def:              "100m",
+			wantErr:          true,
+		},
+		{
+			name:             "overwrite allowed and value matches",
+			variables:        common.JobVariables{{Key: "KUBERNETES_CPU_REQUEST", Value: "500m"}},
+			key:              "KUBERNETES_CPU_REQUEST",
+			overwriteAllowed: "^[0-9]+m$",
+			def:              "100m",
+			want:             "500m",
+		},
+		{
+			name:             "overwrite allowed but value doesn't match",
+			variables:        common.JobVariables{{Key: "KUBERNETES_CPU_REQUEST", Value: "nope"}},
+			key:              "KUBERNETES_CPU_REQUEST",
+			overwriteAllowed: "^[0-9]+m$",
+			def:              "100m",
+			wantErr:          true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := overwriteString(test.variables, test.key, test.overwriteAllowed, test.def)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	kubeerrors "k8s.io/kubernetes/pkg/api/errors"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/retry"
+)
+
+const (
+	retryInitialBackoff = 500 * time.Millisecond
+	retryBackoffFactor  = 2.0
+)
+
+var retryAttemptsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ci_runner_kubernetes_retry_attempts_total",
+		Help: "Total number of retried Kubernetes API calls made by the kubernetes executor, by operation.",
+	},
+	[]string{"operation"},
+)
+
+func init() {
+	prometheus.MustRegister(retryAttemptsTotal)
+}
+
+// isRetryableKubernetesError reports whether err looks like a transient
+// failure (etcd hiccup, webhook timeout, rate limiting, connection reset)
+// worth retrying rather than failing the build outright.
+func isRetryableKubernetesError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if kubeerrors.IsServerTimeout(err) || kubeerrors.IsTooManyRequests(err) || kubeerrors.IsInternalError(err) {
+		return true
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
+
+func (s *executor) retryBackoff() retry.Backoff {
+	max := s.Config.Kubernetes.RetryBackoffMax
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+
+	return retry.Backoff{
+		Initial: retryInitialBackoff,
+		Max:     max,
+		Factor:  retryBackoffFactor,
+	}
+}
+
+func (s *executor) retryLimit() int {
+	if s.Config.Kubernetes.RequestRetryLimit > 0 {
+		return s.Config.Kubernetes.RequestRetryLimit
+	}
+	return 5
+}
+
+// withRetry runs fn with capped exponential backoff, warning the build log
+// and counting the attempt on every retry.
+func (s *executor) withRetry(operation string, fn func() error) error {
+	return retry.Do(s.retryLimit(), s.retryBackoff(), isRetryableKubernetesError, func(attempt int, err error, delay time.Duration) {
+		retryAttemptsTotal.WithLabelValues(operation).Inc()
+		s.Warningln(fmt.Sprintf("Retrying %s after error (attempt %d): %s", operation, attempt+1, err.Error()))
+	}, fn)
+}
@@ -0,0 +1,34 @@
+package kubernetes
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type fakeNetError struct{}
+
+func (fakeNetError) Error() string   { return "fake net error" }
+func (fakeNetError) Timeout() bool   { return true }
+func (fakeNetError) Temporary() bool { return true }
+
+var _ net.Error = fakeNetError{}
+
+func TestIsRetryableKubernetesError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain error", errors.New("boom"), false},
+		{"net error", fakeNetError{}, true},
+		{"connection reset", errors.New("read: connection reset by peer"), true},
+	}
+
+	for _, test := range tests {
+		if got := isRetryableKubernetesError(test.err); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const (
+	nodeSelectorPrefix   = "KUBERNETES_NODE_SELECTOR_"
+	podLabelsPrefix      = "KUBERNETES_POD_LABELS_"
+	podAnnotationsPrefix = "KUBERNETES_POD_ANNOTATIONS_"
+)
+
+// prefixedMap collects every CI variable starting with prefix into a map,
+// keyed by the remainder of the variable name. It is used to let jobs add
+// arbitrary node selectors, pod labels and pod annotations without the
+// runner having to know their names up front.
+func prefixedMap(variables common.JobVariables, prefix string) map[string]string {
+	result := map[string]string{}
+	for _, variable := range variables {
+		if !strings.HasPrefix(variable.Key, prefix) {
+			continue
+		}
+		result[strings.TrimPrefix(variable.Key, prefix)] = variable.Value
+	}
+	return result
+}
+
+// prefixedOverwriteMap is prefixedMap gated by an allow-list regex, the same
+// way every other per-build overwrite in this executor is gated: an empty
+// overwriteAllowed rejects any matching CI variable outright, since letting
+// jobs pin themselves to arbitrary nodes or spoof pod metadata undercuts the
+// namespace/service-account isolation the other overwrites are there for.
+func prefixedOverwriteMap(variables common.JobVariables, prefix, overwriteAllowed string) (map[string]string, error) {
+	found := prefixedMap(variables, prefix)
+	if len(found) == 0 {
+		return found, nil
+	}
+
+	if overwriteAllowed == "" {
+		return nil, fmt.Errorf("%s* overwriting is disabled", prefix)
+	}
+
+	for key, value := range found {
+		matched, err := regexp.MatchString(overwriteAllowed, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for %s overwrite: %s", prefix, err.Error())
+		}
+		if !matched {
+			return nil, fmt.Errorf("%s%s value %q does not match allowed pattern %q", prefix, key, value, overwriteAllowed)
+		}
+	}
+
+	return found, nil
+}
+
+func mergeStringMaps(maps ...map[string]string) map[string]string {
+	result := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// scheduling groups together everything the executor populates on the build
+// pod's PodSpec to place it on the right nodes and give it the right
+// identity within a multi-tenant cluster.
+type scheduling struct {
+	namespace          string
+	serviceAccountName string
+	nodeSelector       map[string]string
+	podLabels          map[string]string
+	podAnnotations     map[string]string
+}
+
+// prepareScheduling resolves the namespace, service account, node selector,
+// pod labels and pod annotations for the build, validating any per-build
+// overwrite against the matching *OverwriteAllowed regex in config.
+func (s *executor) prepareScheduling() error {
+	variables := s.Build.GetAllVariables()
+	k := s.Config.Kubernetes
+
+	namespace, err := overwriteString(variables, "KUBERNETES_NAMESPACE", k.NamespaceOverwriteAllowed, k.Namespace)
+	if err != nil {
+		return err
+	}
+
+	serviceAccountName, err := overwriteString(variables, "KUBERNETES_SERVICE_ACCOUNT", k.ServiceAccountOverwriteAllowed, k.ServiceAccount)
+	if err != nil {
+		return err
+	}
+
+	nodeSelectorOverwrite, err := prefixedOverwriteMap(variables, nodeSelectorPrefix, k.NodeSelectorOverwriteAllowed)
+	if err != nil {
+		return err
+	}
+
+	podLabelsOverwrite, err := prefixedOverwriteMap(variables, podLabelsPrefix, k.PodLabelsOverwriteAllowed)
+	if err != nil {
+		return err
+	}
+
+	podAnnotationsOverwrite, err := prefixedOverwriteMap(variables, podAnnotationsPrefix, k.PodAnnotationsOverwriteAllowed)
+	if err != nil {
+		return err
+	}
+
+	s.scheduling = scheduling{
+		namespace:          namespace,
+		serviceAccountName: serviceAccountName,
+		nodeSelector:       mergeStringMaps(k.NodeSelector, nodeSelectorOverwrite),
+		podLabels:          mergeStringMaps(k.PodLabels, podLabelsOverwrite),
+		podAnnotations:     mergeStringMaps(k.PodAnnotations, podAnnotationsOverwrite),
+	}
+
+	return nil
+}
+
+// tolerations returns a copy of config.Kubernetes.NodeTolerations: the
+// config struct is shared by every concurrent build on this runner, and
+// mergePodSpecTemplate appends to the slice this returns, so handing out the
+// original backing array risks one build's PodSpecTemplate tolerations
+// leaking into another build's pod via spare capacity in that shared slice.
+func (s *executor) tolerations() []api.Toleration {
+	return append([]api.Toleration{}, s.Config.Kubernetes.NodeTolerations...)
+}
+
+func (s *executor) affinity() *api.Affinity {
+	return s.Config.Kubernetes.Affinity
+}
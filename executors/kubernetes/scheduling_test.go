@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestPrefixedMap(t *testing.T) {
+	variables := common.JobVariables{
+		{Key: "KUBERNETES_NODE_SELECTOR_disktype", Value: "ssd"},
+		{Key: "KUBERNETES_NODE_SELECTOR_zone", Value: "us-east-1"},
+		{Key: "OTHER_VARIABLE", Value: "ignored"},
+	}
+
+	got := prefixedMap(variables, nodeSelectorPrefix)
+	want := map[string]string{"disktype": "ssd", "zone": "us-east-1"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPrefixedOverwriteMap(t *testing.T) {
+	tests := []struct {
+		name             string
+		variables        common.JobVariables
+		overwriteAllowed string
+		want             map[string]string
+		wantErr          bool
+	}{
+		{
+			name:      "nothing set returns empty map, no error",
+			variables: common.JobVariables{},
+			want:      map[string]string{},
+		},
+		{
+			name:      "set but overwrite disabled errors",
+			variables: common.JobVariables{{Key: "KUBERNETES_NODE_SELECTOR_disktype", Value: "ssd"}},
+			wantErr:   true,
+		},
+		{
+			name:             "set and allowed",
+			variables:        common.JobVariables{{Key: "KUBERNETES_NODE_SELECTOR_disktype", Value: "ssd"}},
+			overwriteAllowed: "^ssd$",
+			want:             map[string]string{"disktype": "ssd"},
+		},
+		{
+			name:             "set and disallowed by pattern",
+			variables:        common.JobVariables{{Key: "KUBERNETES_NODE_SELECTOR_disktype", Value: "hdd"}},
+			overwriteAllowed: "^ssd$",
+			wantErr:          true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := prefixedOverwriteMap(test.variables, nodeSelectorPrefix, test.overwriteAllowed)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got nil", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeStringMaps(t *testing.T) {
+	got := mergeStringMaps(
+		map[string]string{"a": "1", "b": "2"},
+		map[string]string{"b": "overwritten", "c": "3"},
+	)
+	want := map[string]string{"a": "1", "b": "overwritten", "c": "3"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
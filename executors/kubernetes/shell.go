@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const (
+	shellVariableName = "KUBERNETES_SHELL"
+
+	shellPwsh = "pwsh"
+	shellBash = "bash"
+	shellSh   = "sh"
+)
+
+// detectionScript execs the first of pwsh, bash or sh found on $PATH inside
+// the build container, so images that only ship one of them (Windows
+// containers, minimal pwsh-only images, ...) still work without the runner
+// having to know in advance which shell is present.
+const detectionScript = `
+if command -v pwsh >/dev/null 2>&1; then exec pwsh -NoProfile -Command -
+elif command -v bash >/dev/null 2>&1; then exec bash
+elif command -v sh >/dev/null 2>&1; then exec sh
+else echo "no supported shell (pwsh, bash, sh) found in image" >&2; exit 1
+fi
+`
+
+// resolveShell resolves which shell to target for this build: an explicit
+// KUBERNETES_SHELL CI variable wins, then config.Kubernetes.Shell. If
+// neither pins one down, it returns "" so shellCommand runs the pwsh/bash/sh
+// auto-detection script instead of assuming bash is present in the image.
+func resolveShell(variables common.JobVariables, configShell string) string {
+	if value := variables.Get(shellVariableName); value != "" {
+		return value
+	}
+
+	return configShell
+}
+
+func (s *executor) shellName() string {
+	return resolveShell(s.Build.GetAllVariables(), s.Config.Kubernetes.Shell)
+}
+
+// helperRunnerCommand returns how the helper binary baked into the helper
+// image should be invoked for the selected shell. pwsh can't source an
+// arbitrary ELF binary as its stdin-fed "script", so it has to be asked to
+// run it explicitly; every other supported shell execs it directly.
+func helperRunnerCommand(shell string) string {
+	const helperPath = "/usr/bin/gitlab-runner-helper"
+
+	if shell == shellPwsh {
+		return fmt.Sprintf("pwsh -NoProfile -Command %s", helperPath)
+	}
+
+	return helperPath
+}
+
+// scriptExtension returns the file extension the generated stage script
+// should carry for the selected shell, used for the configmap-mounted
+// script file when the shell needs one (see scriptFileName/scriptFileCommand).
+// The helper's RunnerCommand is derived separately, in helperRunnerCommand.
+func scriptExtension(shell string) string {
+	if shell == shellPwsh {
+		return "ps1"
+	}
+	return "sh"
+}
+
+// shellCommand is the command used to attach to a container and feed it the
+// stage script: the detection script when the shell wasn't pinned down, or a
+// direct exec of the selected shell otherwise.
+func shellCommand(shell string) []string {
+	switch shell {
+	case shellBash, shellPwsh, shellSh:
+		return []string{shell}
+	default:
+		return []string{"sh", "-c", detectionScript}
+	}
+}
+
+// scriptConfigMapName returns the prefix of the generated name of the
+// ConfigMap used to pass the stage script to containers whose shell can't
+// read it from stdin.
+func (s *executor) scriptConfigMapName() string {
+	return s.Build.ProjectUniqueName() + "-script"
+}
+
+const scriptVolumeName = "build-script"
+const scriptMountPath = "/scripts"
+
+// createScriptConfigMap uploads the stage script as a ConfigMap so it can be
+// mounted as a volume, for shells such as cmd that cannot read a script
+// from stdin. It is only used when s.BuildShell.PassFile is set.
+func (s *executor) createScriptConfigMap(script string) (*api.ConfigMap, error) {
+	return s.kubeClient.ConfigMaps(s.scheduling.namespace).Create(&api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{
+			GenerateName: s.scriptConfigMapName(),
+			Namespace:    s.scheduling.namespace,
+		},
+		Data: map[string]string{
+			s.scriptFileName(): script,
+		},
+	})
+}
+
+// scriptFileName is the key the stage script is stored under in the script
+// ConfigMap, and the name it's mounted as under scriptMountPath.
+func (s *executor) scriptFileName() string {
+	return fmt.Sprintf("build.%s", scriptExtension(s.shell))
+}
+
+// updateScriptConfigMap refreshes the mounted script file with the stage
+// script for the container about to run, for shells that need a file
+// instead of stdin.
+func (s *executor) updateScriptConfigMap(script string) error {
+	s.scriptConfigMap.Data = map[string]string{
+		s.scriptFileName(): script,
+	}
+
+	updated, err := s.kubeClient.ConfigMaps(s.scriptConfigMap.Namespace).Update(s.scriptConfigMap)
+	if err != nil {
+		return fmt.Errorf("updating script configmap: %s", err.Error())
+	}
+
+	s.scriptConfigMap = updated
+	return nil
+}
+
+// scriptFileCommand execs the mounted script file with the selected shell,
+// for containers whose shell can't read the stage script from stdin.
+func scriptFileCommand(shell string) []string {
+	path := fmt.Sprintf("%s/build.%s", scriptMountPath, scriptExtension(shell))
+	if shell == shellPwsh {
+		return []string{shellPwsh, "-NoProfile", "-File", path}
+	}
+	return []string{shell, path}
+}
+
+// readScriptCommand prints the mounted script file's current contents, used
+// by waitForScriptSync to poll for the kubelet ConfigMap volume sync to
+// catch up with the content just written by updateScriptConfigMap.
+func readScriptCommand(shell string) []string {
+	path := fmt.Sprintf("%s/build.%s", scriptMountPath, scriptExtension(shell))
+	if shell == shellPwsh {
+		return []string{shellPwsh, "-NoProfile", "-Command", fmt.Sprintf("Get-Content %s", path)}
+	}
+	return []string{"cat", path}
+}
+
+func (s *executor) deleteScriptConfigMap(configMap *api.ConfigMap) {
+	if configMap == nil {
+		return
+	}
+
+	err := s.kubeClient.ConfigMaps(configMap.Namespace).Delete(configMap.Name)
+	if err != nil {
+		s.Errorln(fmt.Sprintf("Error cleaning up script configmap: %s", err.Error()))
+	}
+}
+
+// scriptVolume mounts the script ConfigMap directly as a ConfigMap volume so
+// the container can read it as a regular file rather than from stdin; the
+// file is not copied into an emptyDir.
+func scriptVolume(configMap *api.ConfigMap) api.Volume {
+	return api.Volume{
+		Name: scriptVolumeName,
+		VolumeSource: api.VolumeSource{
+			ConfigMap: &api.ConfigMapVolumeSource{
+				LocalObjectReference: api.LocalObjectReference{Name: configMap.Name},
+			},
+		},
+	}
+}
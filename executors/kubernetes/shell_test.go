@@ -0,0 +1,54 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestResolveShell(t *testing.T) {
+	tests := []struct {
+		name        string
+		variables   common.JobVariables
+		configShell string
+		want        string
+	}{
+		{"neither set", common.JobVariables{}, "", ""},
+		{"config only", common.JobVariables{}, "pwsh", "pwsh"},
+		{"variable wins over config", common.JobVariables{{Key: shellVariableName, Value: "bash"}}, "pwsh", "bash"},
+	}
+
+	for _, test := range tests {
+		if got := resolveShell(test.variables, test.configShell); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestHelperRunnerCommand(t *testing.T) {
+	if got := helperRunnerCommand(shellBash); got != "/usr/bin/gitlab-runner-helper" {
+		t.Errorf("bash: got %q", got)
+	}
+	if got := helperRunnerCommand(shellPwsh); got != "pwsh -NoProfile -Command /usr/bin/gitlab-runner-helper" {
+		t.Errorf("pwsh: got %q", got)
+	}
+}
+
+func TestScriptExtension(t *testing.T) {
+	if got := scriptExtension(shellPwsh); got != "ps1" {
+		t.Errorf("pwsh: got %q, want ps1", got)
+	}
+	if got := scriptExtension(shellBash); got != "sh" {
+		t.Errorf("bash: got %q, want sh", got)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	if got := shellCommand(shellBash); !reflect.DeepEqual(got, []string{"bash"}) {
+		t.Errorf("bash: got %v", got)
+	}
+	if got := shellCommand(""); !reflect.DeepEqual(got, []string{"sh", "-c", detectionScript}) {
+		t.Errorf("empty shell: got %v, want detection script", got)
+	}
+}
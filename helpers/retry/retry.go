@@ -0,0 +1,77 @@
+// Package retry provides a small capped-exponential-backoff helper used by
+// executors to ride out transient errors from remote APIs (Kubernetes,
+// Docker, ...) instead of failing a build outright.
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes a capped exponential backoff with jitter: the nth retry
+// waits min(Max, Initial*Factor^n +/- up to 50% jitter), so it never exceeds Max.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// Duration returns the delay to use before the given retry attempt (0-based).
+func (b Backoff) Duration(attempt int) time.Duration {
+	delay := float64(b.Initial)
+	for i := 0; i < attempt; i++ {
+		delay *= b.Factor
+	}
+
+	jitter := delay * (rand.Float64() - 0.5)
+	delay += jitter
+
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	return time.Duration(delay)
+}
+
+// ShouldRetry decides whether an error returned by the wrapped call is worth
+// retrying.
+type ShouldRetry func(err error) bool
+
+// OnRetry is called before each retry, just before sleeping for the backoff
+// delay it is given, letting the caller log or count the attempt.
+type OnRetry func(attempt int, err error, delay time.Duration)
+
+// Do calls fn until it succeeds, shouldRetry returns false for the error it
+// returned, or limit retries (limit+1 calls in all) have been made, whichever
+// comes first.
+func Do(limit int, backoff Backoff, shouldRetry ShouldRetry, onRetry OnRetry, fn func() error) error {
+	var err error
+
+	for attempt := 0; attempt <= limit; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if !shouldRetry(err) {
+			return err
+		}
+
+		if attempt == limit {
+			break
+		}
+
+		delay := backoff.Duration(attempt)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+		time.Sleep(delay)
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %s", limit+1, err.Error())
+}
@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDurationIsCapped(t *testing.T) {
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: 200 * time.Millisecond, Factor: 2.0}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		got := backoff.Duration(attempt)
+		if got < 0 {
+			t.Fatalf("Duration(%d) = %s, want >= 0", attempt, got)
+		}
+		if got > backoff.Max {
+			t.Fatalf("Duration(%d) = %s, want <= Max (%s)", attempt, got, backoff.Max)
+		}
+	}
+}
+
+func TestDoSucceedsWithoutRetry(t *testing.T) {
+	calls := 0
+	err := Do(3, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Factor: 1}, func(error) bool { return true }, nil, func() error {
+		calls++
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+}
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Do(3, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Factor: 1}, func(error) bool { return true }, nil, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+}
+
+func TestDoStopsWhenShouldRetryReturnsFalse(t *testing.T) {
+	calls := 0
+	err := Do(3, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Factor: 1}, func(error) bool { return false }, nil, func() error {
+		calls++
+		return errors.New("permanent")
+	})
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+}
+
+func TestDoGivesUpAfterLimit(t *testing.T) {
+	calls := 0
+	err := Do(2, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Factor: 1}, func(error) bool { return true }, nil, func() error {
+		calls++
+		return errors.New("always fails")
+	})
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if calls != 3 {
+		t.Fatalf("got %d calls, want 3 (1 initial + 2 retries)", calls)
+	}
+}